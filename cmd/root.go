@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var cfg = config.New()
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "ssosync",
+	Short: "Sync Google Directory or Azure AD to AWS SSO",
+	Long: `ssosync will take users and groups from Google Workspace (or
+Azure AD / Entra ID) and sync them to AWS SSO using the SCIM protocol.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.DoSync(context.Background(), cfg)
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags
+// appropriately. This is called by main.main(). It only needs to happen
+// once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	cobra.OnInitialize(initConfig)
+
+	rootCmd.PersistentFlags().BoolVar(&cfg.Debug, "debug", false, "enable verbose logging")
+	rootCmd.PersistentFlags().StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "log format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&cfg.GoogleCredentials, "google-credentials", "credentials.json", "path to Google service account credentials")
+	rootCmd.PersistentFlags().StringVar(&cfg.GoogleAdmin, "google-admin", "", "email of the Google Workspace admin to impersonate")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMEndpoint, "scim-endpoint", "", "AWS SSO SCIM endpoint")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMAccessToken, "scim-access-token", "", "AWS SSO SCIM access token")
+	rootCmd.PersistentFlags().StringVar(&cfg.GroupMatch, "group-match", "", "Google Directory API search query to scope which groups are synced")
+	rootCmd.PersistentFlags().StringVar(&cfg.UserMatch, "user-match", "", "Google Directory API search query to scope which users are synced")
+	rootCmd.PersistentFlags().StringVar(&cfg.ConfigFile, "config", "", "path to a declarative groups.yaml to reconcile instead of mirroring the whole directory")
+	rootCmd.PersistentFlags().BoolVar(&cfg.DryRun, "dry-run", false, "preview create/update/delete actions without making them")
+	rootCmd.PersistentFlags().StringVar(&cfg.MappingsFile, "mappings-file", "", "path to a YAML file mapping groups to AWS SSO permission sets/accounts")
+	rootCmd.PersistentFlags().StringVar(&cfg.SSOInstanceArn, "sso-instance-arn", "", "ARN of the AWS SSO instance to provision account assignments in")
+	rootCmd.PersistentFlags().StringVar(&cfg.Region, "region", "", "AWS region of the SSO instance")
+	rootCmd.PersistentFlags().IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "max users/groups synced concurrently")
+	rootCmd.PersistentFlags().Float64Var(&cfg.AWSRPS, "aws-rps", 0, "max requests per second to the AWS SSO SCIM endpoint (0 = unlimited)")
+	rootCmd.PersistentFlags().Float64Var(&cfg.GoogleRPS, "google-rps", 0, "max requests per second to the Google Directory API (0 = unlimited)")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroupDepth, "max-group-depth", 0, "max levels of nested Google groups to expand when resolving membership (0 = package default)")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IgnoreUsers, "ignore-users", nil, "glob patterns of user emails ssosync should never create, update, or delete")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IgnoreGroups, "ignore-groups", nil, "glob patterns of group names ssosync should never create, update, or delete")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IncludeGroups, "include-groups", nil, "glob patterns restricting sync to matching group names (default: every group matched by --group-match)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.ManagedTag, "managed-tag", false, "tag created users/groups as managed-by ssosync and refuse to delete anything lacking that tag")
+	rootCmd.PersistentFlags().StringVar(&cfg.IdentityProvider, "identity-provider", cfg.IdentityProvider, "identity provider to sync from (google, azuread)")
+	rootCmd.PersistentFlags().StringVar(&cfg.AzureTenantID, "azure-tenant-id", "", "Azure AD tenant ID, required when --identity-provider is azuread")
+	rootCmd.PersistentFlags().StringVar(&cfg.AzureClientID, "azure-client-id", "", "Azure AD application (client) ID, required when --identity-provider is azuread")
+	rootCmd.PersistentFlags().StringVar(&cfg.AzureClientSecret, "azure-client-secret", "", "Azure AD application client secret, required when --identity-provider is azuread")
+
+	viper.BindPFlags(rootCmd.PersistentFlags())
+}
+
+func initConfig() {
+	viper.SetEnvPrefix("ssosync")
+	viper.AutomaticEnv()
+}
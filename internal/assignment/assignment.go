@@ -0,0 +1,135 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assignment
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin"
+	"github.com/aws/aws-sdk-go-v2/service/ssoadmin/types"
+)
+
+// Client reconciles AWS SSO Admin account assignments for a group so
+// that the permission sets/accounts declared in its Mappings are the
+// only ones it grants.
+type Client interface {
+	Reconcile(ctx context.Context, groupID string, mappings []Mapping) error
+}
+
+type client struct {
+	svc         *ssoadmin.Client
+	instanceArn string
+}
+
+// NewClient creates a new Client for the AWS SSO instance identified
+// by instanceArn
+func NewClient(cfg aws.Config, instanceArn string) Client {
+	return &client{
+		svc:         ssoadmin.NewFromConfig(cfg),
+		instanceArn: instanceArn,
+	}
+}
+
+// Reconcile creates any account assignment declared in mappings that
+// doesn't yet exist for groupID, and removes any assignment previously
+// granted to groupID for a permission set/account pair mappings no
+// longer declares.
+func (c *client) Reconcile(ctx context.Context, groupID string, mappings []Mapping) error {
+	desired := make(map[string]bool)
+
+	for _, m := range mappings {
+		for _, accountID := range m.AccountIDs {
+			desired[accountID+"|"+m.PermissionSetArn] = true
+		}
+	}
+
+	existing, err := c.assignmentsForGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	for key := range desired {
+		if existing[key] {
+			continue
+		}
+
+		accountID, permissionSetArn := splitKey(key)
+		if _, err := c.svc.CreateAccountAssignment(ctx, &ssoadmin.CreateAccountAssignmentInput{
+			InstanceArn:      &c.instanceArn,
+			TargetId:         &accountID,
+			TargetType:       types.TargetTypeAwsAccount,
+			PermissionSetArn: &permissionSetArn,
+			PrincipalId:      &groupID,
+			PrincipalType:    types.PrincipalTypeGroup,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for key := range existing {
+		if desired[key] {
+			continue
+		}
+
+		accountID, permissionSetArn := splitKey(key)
+		if _, err := c.svc.DeleteAccountAssignment(ctx, &ssoadmin.DeleteAccountAssignmentInput{
+			InstanceArn:      &c.instanceArn,
+			TargetId:         &accountID,
+			TargetType:       types.TargetTypeAwsAccount,
+			PermissionSetArn: &permissionSetArn,
+			PrincipalId:      &groupID,
+			PrincipalType:    types.PrincipalTypeGroup,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assignmentsForGroup returns the account assignments AWS SSO
+// currently grants groupID, keyed by "<account id>|<permission set arn>".
+func (c *client) assignmentsForGroup(ctx context.Context, groupID string) (map[string]bool, error) {
+	assignments := make(map[string]bool)
+
+	paginator := ssoadmin.NewListAccountAssignmentsForPrincipalPaginator(c.svc, &ssoadmin.ListAccountAssignmentsForPrincipalInput{
+		InstanceArn:   &c.instanceArn,
+		PrincipalId:   &groupID,
+		PrincipalType: types.PrincipalTypeGroup,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range page.AccountAssignments {
+			assignments[*a.AccountId+"|"+*a.PermissionSetArn] = true
+		}
+	}
+
+	return assignments, nil
+}
+
+func splitKey(key string) (accountID string, permissionSetArn string) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == '|' {
+			return key[:i], key[i+1:]
+		}
+	}
+	return key, ""
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package assignment reconciles AWS SSO account assignments, the step
+// that turns a group mirrored by internal.SyncGroups into actual access
+// to AWS accounts.
+package assignment
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Mapping declares that a Google group should grant its members a
+// permission set on one or more AWS accounts once it has been mirrored
+// into AWS SSO.
+type Mapping struct {
+	GroupName        string   `yaml:"group_name"`
+	PermissionSetArn string   `yaml:"permission_set_arn"`
+	AccountIDs       []string `yaml:"account_ids"`
+}
+
+// LoadMappings reads a declarative group -> permission set/accounts
+// mapping from the YAML file at path. Only a local file is read; the
+// document is not fetched from SSM or any other remote store.
+func LoadMappings(path string) ([]Mapping, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Mappings []Mapping `yaml:"mappings"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc.Mappings, nil
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/awslabs/ssosync/internal/retry"
+	"golang.org/x/time/rate"
+)
+
+// Config holds the settings needed to reach the AWS SSO SCIM endpoint
+type Config struct {
+	Endpoint string
+	Token    string
+
+	// RPS caps the number of SCIM requests issued per second, since
+	// AWS SSO's SCIM quota is independent of (and usually tighter than)
+	// Google's Directory API quota. Zero means unlimited.
+	RPS float64
+}
+
+// Client represents an interface of methods used to communicate with
+// the AWS SSO SCIM endpoint
+type Client interface {
+	CreateUser(*User) (*User, error)
+	DeleteUser(*User) error
+	FindUserByEmail(string) (*User, error)
+
+	CreateGroup(*Group) (*Group, error)
+	DeleteGroup(*Group) error
+	GetGroups() (*map[string]Group, error)
+
+	// ListGroupMemberships returns the set of AWS user IDs belonging to
+	// g in a single SCIM call, so callers diffing membership for many
+	// users don't issue one membership-check request each.
+	ListGroupMemberships(g *Group) (map[string]bool, error)
+	AddUserToGroup(*User, *Group) error
+	RemoveUserFromGroup(*User, *Group) error
+}
+
+type client struct {
+	httpClient *http.Client
+	endpoint   string
+	token      string
+	limiter    *rate.Limiter
+}
+
+// NewClient creates a new client to talk with AWS SSO's SCIM endpoint
+func NewClient(httpClient *http.Client, config *Config) (Client, error) {
+	var limiter *rate.Limiter
+	if config.RPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(config.RPS), 1)
+	}
+
+	return &client{
+		httpClient: httpClient,
+		endpoint:   config.Endpoint,
+		token:      config.Token,
+		limiter:    limiter,
+	}, nil
+}
+
+// userReadAttributes and groupReadAttributes are passed as the SCIM
+// "attributes" query parameter on reads of existing users/groups.
+// AWS SSO's SCIM implementation treats attributes as a strict allow
+// list - externalId is not returned on reads unless explicitly
+// requested - so these must list every field canDelete's ManagedTag
+// check and the rest of the package depend on, or ExternalID silently
+// comes back empty and nothing ssosync created is ever recognized as
+// deletable.
+const (
+	userReadAttributes  = "id,userName,name,displayName,active,emails,externalId"
+	groupReadAttributes = "id,displayName,externalId"
+)
+
+// isRetryable reports whether err came from a throttled or transient
+// SCIM response and the caller should back off and try again.
+func isRetryable(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && (se.code == http.StatusTooManyRequests || se.code >= http.StatusInternalServerError)
+}
+
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func (c *client) do(method string, path string, body interface{}, out interface{}) error {
+	return retry.Do(isRetryable, func() error {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(context.Background()); err != nil {
+				return err
+			}
+		}
+
+		var reqBody *bytes.Buffer
+		if body != nil {
+			b, err := json.Marshal(body)
+			if err != nil {
+				return err
+			}
+			reqBody = bytes.NewBuffer(b)
+		} else {
+			reqBody = bytes.NewBuffer(nil)
+		}
+
+		req, err := http.NewRequest(method, c.endpoint+path, reqBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Content-Type", "application/scim+json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return &statusError{
+				code: resp.StatusCode,
+				err:  fmt.Errorf("aws: unexpected status %d calling %s %s", resp.StatusCode, method, path),
+			}
+		}
+
+		if out != nil {
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+
+		return nil
+	})
+}
+
+// CreateUser creates the given user in AWS SSO
+func (c *client) CreateUser(u *User) (*User, error) {
+	out := &User{}
+	if err := c.do(http.MethodPost, "/Users", u, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteUser removes the given user from AWS SSO
+func (c *client) DeleteUser(u *User) error {
+	return c.do(http.MethodDelete, "/Users/"+u.ID, nil, nil)
+}
+
+// FindUserByEmail looks up a user by their primary email, returning
+// nil if no user could be found
+func (c *client) FindUserByEmail(email string) (*User, error) {
+	out := struct {
+		Resources []User `json:"Resources"`
+	}{}
+
+	path := "/Users?filter=userName eq \"" + email + "\"&attributes=" + userReadAttributes
+	if err := c.do(http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+
+	if len(out.Resources) == 0 {
+		return nil, nil
+	}
+
+	return &out.Resources[0], nil
+}
+
+// CreateGroup creates the given group in AWS SSO
+func (c *client) CreateGroup(g *Group) (*Group, error) {
+	out := &Group{}
+	if err := c.do(http.MethodPost, "/Groups", g, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteGroup removes the given group from AWS SSO
+func (c *client) DeleteGroup(g *Group) error {
+	return c.do(http.MethodDelete, "/Groups/"+g.ID, nil, nil)
+}
+
+// GetGroups returns all groups known to AWS SSO keyed by display name
+func (c *client) GetGroups() (*map[string]Group, error) {
+	out := struct {
+		Resources []Group `json:"Resources"`
+	}{}
+
+	if err := c.do(http.MethodGet, "/Groups?attributes="+groupReadAttributes, nil, &out); err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]Group)
+	for _, g := range out.Resources {
+		groups[g.DisplayName] = g
+	}
+
+	return &groups, nil
+}
+
+// ListGroupMemberships returns the set of AWS user IDs belonging to g
+// in a single SCIM call
+func (c *client) ListGroupMemberships(g *Group) (map[string]bool, error) {
+	out := struct {
+		Members []struct {
+			Value string `json:"value"`
+		} `json:"members"`
+	}{}
+
+	if err := c.do(http.MethodGet, "/Groups/"+g.ID+"?attributes=members", nil, &out); err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]bool, len(out.Members))
+	for _, m := range out.Members {
+		members[m.Value] = true
+	}
+
+	return members, nil
+}
+
+// AddUserToGroup adds the given user to the given group
+func (c *client) AddUserToGroup(u *User, g *Group) error {
+	return c.do(http.MethodPatch, "/Groups/"+g.ID, map[string]interface{}{
+		"Operations": []map[string]interface{}{
+			{
+				"op":   "add",
+				"path": "members",
+				"value": []map[string]string{
+					{"value": u.ID},
+				},
+			},
+		},
+	}, nil)
+}
+
+// RemoveUserFromGroup removes the given user from the given group
+func (c *client) RemoveUserFromGroup(u *User, g *Group) error {
+	return c.do(http.MethodPatch, "/Groups/"+g.ID, map[string]interface{}{
+		"Operations": []map[string]interface{}{
+			{
+				"op":   "remove",
+				"path": fmt.Sprintf("members[value eq \"%s\"]", u.ID),
+			},
+		},
+	}, nil)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+// User represents an AWS SSO SCIM user
+type User struct {
+	ID       string `json:"id,omitempty"`
+	Username string `json:"userName"`
+	Name     struct {
+		FamilyName string `json:"familyName"`
+		GivenName  string `json:"givenName"`
+	} `json:"name"`
+	DisplayName string `json:"displayName"`
+	Active      bool   `json:"active"`
+	Emails      []struct {
+		Value   string `json:"value"`
+		Type    string `json:"type"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+
+	// ExternalID is the free-form SCIM core attribute ssosync uses to
+	// mark the users it created, so a ManagedTag sync can tell them
+	// apart from users provisioned by other tooling.
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+// NewUser creates a new SCIM user ready to be sent to AWS SSO
+func NewUser(firstName string, lastName string, email string) *User {
+	u := &User{
+		Username:    email,
+		DisplayName: firstName + " " + lastName,
+		Active:      true,
+	}
+
+	u.Name.GivenName = firstName
+	u.Name.FamilyName = lastName
+
+	u.Emails = []struct {
+		Value   string `json:"value"`
+		Type    string `json:"type"`
+		Primary bool   `json:"primary"`
+	}{
+		{
+			Value:   email,
+			Type:    "work",
+			Primary: true,
+		},
+	}
+
+	return u
+}
+
+// Group represents an AWS SSO SCIM group
+type Group struct {
+	ID          string `json:"id,omitempty"`
+	DisplayName string `json:"displayName"`
+
+	// ExternalID is the free-form SCIM core attribute ssosync uses to
+	// mark the groups it created, so a ManagedTag sync can tell them
+	// apart from groups provisioned by other tooling.
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+// NewGroup creates a new SCIM group ready to be sent to AWS SSO
+func NewGroup(displayName string) *Group {
+	return &Group{
+		DisplayName: displayName,
+	}
+}
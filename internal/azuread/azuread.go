@@ -0,0 +1,281 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azuread implements identity.Source against Azure AD / Entra ID
+// via Microsoft Graph, so ssosync can mirror an Azure tenant into AWS SSO
+// the same way it mirrors a Google Workspace domain.
+package azuread
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/awslabs/ssosync/internal/identity"
+	msgraphsdkgo "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/microsoftgraph/msgraph-sdk-go/directory"
+	"github.com/microsoftgraph/msgraph-sdk-go/groups"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+)
+
+// graphScopes is the Microsoft Graph application permission ssosync
+// authenticates with; User.Read.All and Group.Read.All are granted to
+// the app registration identified by Config.
+var graphScopes = []string{"https://graph.microsoft.com/.default"}
+
+// defaultMaxGroupDepth mirrors the google package's default, bounding
+// nested group expansion when Config.MaxGroupDepth is left unset.
+const defaultMaxGroupDepth = 5
+
+// Config holds the settings needed to reach Microsoft Graph
+type Config struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// MaxGroupDepth bounds how many levels of nested groups
+	// GetGroupMembers will expand. Zero uses defaultMaxGroupDepth.
+	MaxGroupDepth int
+}
+
+type client struct {
+	graph         *msgraphsdkgo.GraphServiceClient
+	maxGroupDepth int
+}
+
+// NewClient creates a new client to talk with Microsoft Graph,
+// authenticating as the app registration identified by config.
+func NewClient(ctx context.Context, config *Config) (identity.Source, error) {
+	cred, err := azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, config.ClientSecret, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := msgraphsdkgo.NewGraphServiceClientWithCredentials(cred, graphScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	maxGroupDepth := config.MaxGroupDepth
+	if maxGroupDepth == 0 {
+		maxGroupDepth = defaultMaxGroupDepth
+	}
+
+	return &client{graph: graph, maxGroupDepth: maxGroupDepth}, nil
+}
+
+// GetUsers returns every enabled user matching query, an OData $filter
+// expression (e.g. "startswith(mail,'aws-')"). An empty query returns
+// every user.
+func (c *client) GetUsers(query string) ([]*identity.User, error) {
+	requestConfig := &users.UsersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.UsersRequestBuilderGetQueryParameters{
+			Select: []string{"id", "mail", "userPrincipalName", "givenName", "surname", "accountEnabled"},
+		},
+	}
+	if query != "" {
+		requestConfig.QueryParameters.Filter = &query
+	}
+
+	resp, err := c.graph.Users().Get(context.Background(), requestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*identity.User
+	iterator, err := msgraphcore.NewPageIterator[models.Userable](resp, c.graph.GetAdapter(), models.CreateUserCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	err = iterator.Iterate(context.Background(), func(u models.Userable) bool {
+		if u.GetAccountEnabled() != nil && !*u.GetAccountEnabled() {
+			return true
+		}
+		out = append(out, toIdentityUser(u))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetDeletedUsers returns every user matching query that the tenant
+// currently lists among its soft-deleted items.
+func (c *client) GetDeletedUsers(query string) ([]*identity.User, error) {
+	requestConfig := &directory.DeletedItemsMicrosoftGraphUserRequestBuilderGetRequestConfiguration{
+		QueryParameters: &directory.DeletedItemsMicrosoftGraphUserRequestBuilderGetQueryParameters{
+			Select: []string{"id", "mail", "userPrincipalName", "givenName", "surname"},
+		},
+	}
+	if query != "" {
+		requestConfig.QueryParameters.Filter = &query
+	}
+
+	resp, err := c.graph.Directory().DeletedItems().MicrosoftGraphUser().Get(context.Background(), requestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*identity.User
+	iterator, err := msgraphcore.NewPageIterator[models.Userable](resp, c.graph.GetAdapter(), models.CreateUserCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	err = iterator.Iterate(context.Background(), func(u models.Userable) bool {
+		out = append(out, toIdentityUser(u))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetGroups returns every group matching query, an OData $filter
+// expression. An empty query returns every group.
+func (c *client) GetGroups(query string) ([]*identity.Group, error) {
+	requestConfig := &groups.GroupsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &groups.GroupsRequestBuilderGetQueryParameters{
+			Select: []string{"id", "displayName", "mail"},
+		},
+	}
+	if query != "" {
+		requestConfig.QueryParameters.Filter = &query
+	}
+
+	resp, err := c.graph.Groups().Get(context.Background(), requestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*identity.Group
+	iterator, err := msgraphcore.NewPageIterator[models.Groupable](resp, c.graph.GetAdapter(), models.CreateGroupCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	err = iterator.Iterate(context.Background(), func(g models.Groupable) bool {
+		out = append(out, toIdentityGroup(g))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// GetGroupMembers returns the transitive union of g's user members,
+// expanding any nested groups it contains up to the client's configured
+// max depth. Groups already seen along the current expansion (including
+// g itself) are not revisited, which protects against membership cycles.
+func (c *client) GetGroupMembers(g *identity.Group) ([]*identity.Member, error) {
+	return c.groupMembers(g, 0, map[string]bool{})
+}
+
+func (c *client) groupMembers(g *identity.Group, depth int, visited map[string]bool) ([]*identity.Member, error) {
+	if visited[g.ID] {
+		return nil, nil
+	}
+	visited[g.ID] = true
+
+	resp, err := c.graph.Groups().ByGroupId(g.ID).Members().Get(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*identity.Member
+
+	iterator, err := msgraphcore.NewPageIterator[models.DirectoryObjectable](resp, c.graph.GetAdapter(), models.CreateDirectoryObjectCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, err
+	}
+
+	var walkErr error
+	err = iterator.Iterate(context.Background(), func(obj models.DirectoryObjectable) bool {
+		user, ok := obj.(models.Userable)
+		if ok {
+			members = append(members, &identity.Member{ID: derefString(user.GetId()), Email: userEmail(user)})
+			return true
+		}
+
+		nestedGroup, ok := obj.(models.Groupable)
+		if !ok || depth >= c.maxGroupDepth {
+			return true
+		}
+
+		nestedMembers, nestedErr := c.groupMembers(toIdentityGroup(nestedGroup), depth+1, visited)
+		if nestedErr != nil {
+			walkErr = nestedErr
+			return false
+		}
+		members = append(members, nestedMembers...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	return members, nil
+}
+
+// toIdentityUser translates a Microsoft Graph user into the provider-
+// agnostic identity.User model syncGSuite reconciles against AWS SSO.
+func toIdentityUser(u models.Userable) *identity.User {
+	return &identity.User{
+		ID:         derefString(u.GetId()),
+		Email:      userEmail(u),
+		GivenName:  derefString(u.GetGivenName()),
+		FamilyName: derefString(u.GetSurname()),
+	}
+}
+
+// userEmail returns u's mail attribute, falling back to
+// userPrincipalName when mail is unset. Entra ID leaves mail null for
+// any user without an Exchange mailbox, and syncing such a user with an
+// empty email would give it an empty SCIM userName in AWS SSO.
+func userEmail(u models.Userable) string {
+	if mail := derefString(u.GetMail()); mail != "" {
+		return mail
+	}
+	return derefString(u.GetUserPrincipalName())
+}
+
+// toIdentityGroup translates a Microsoft Graph group into the provider-
+// agnostic identity.Group model.
+func toIdentityGroup(g models.Groupable) *identity.Group {
+	return &identity.Group{
+		ID:    derefString(g.GetId()),
+		Name:  derefString(g.GetDisplayName()),
+		Email: derefString(g.GetMail()),
+	}
+}
+
+// derefString returns "" for a nil *string instead of panicking, since
+// most Graph model getters return nil when a field wasn't selected.
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the settings that drive a ssosync run, whether
+// they were supplied via flags, environment variables, or Lambda
+// configuration.
+package config
+
+// Config holds all the settings needed to run a sync between Google
+// Workspace (or Azure AD / Entra ID) and AWS SSO
+type Config struct {
+	Debug             bool   `mapstructure:"debug"`
+	GoogleCredentials string `mapstructure:"google_credentials"`
+	GoogleAdmin       string `mapstructure:"google_admin"`
+	LogLevel          string `mapstructure:"log_level"`
+	LogFormat         string `mapstructure:"log_format"`
+	SCIMAccessToken   string `mapstructure:"scim_access_token"`
+	SCIMEndpoint      string `mapstructure:"scim_endpoint"`
+	IsLambda          bool
+
+	// GroupMatch and UserMatch are Google Directory API search queries
+	// (e.g. "email:aws-*") used to scope GetGroups/GetUsers to the
+	// identities that matter to AWS SSO instead of the whole directory.
+	GroupMatch string `mapstructure:"group_match"`
+	UserMatch  string `mapstructure:"user_match"`
+
+	// ConfigFile points at a declarative groups.yaml describing which
+	// Google groups (and optionally members) should be reconciled into
+	// AWS SSO. When empty, ssosync mirrors the entire directory as before.
+	ConfigFile string `mapstructure:"config_file"`
+
+	// DryRun, when true, logs every create/update/delete that would be
+	// made against aws.Client and the configured identity.Source without
+	// making it.
+	DryRun bool `mapstructure:"dry_run"`
+
+	// MappingsFile points at a YAML document mapping Google group names
+	// to the AWS SSO permission set/account combinations their members
+	// should be assigned, reconciled after SyncGroups completes.
+	MappingsFile string `mapstructure:"mappings_file"`
+
+	// SSOInstanceArn and Region identify the AWS SSO instance that
+	// MappingsFile's account assignments are reconciled against.
+	SSOInstanceArn string `mapstructure:"sso_instance_arn"`
+	Region         string `mapstructure:"region"`
+
+	// Concurrency bounds how many users/groups SyncUsers/SyncGroups
+	// process in flight at once.
+	Concurrency int `mapstructure:"concurrency"`
+
+	// AWSRPS and GoogleRPS cap requests per second issued to the AWS
+	// SSO SCIM endpoint and the Google Directory API respectively,
+	// since the two backends enforce independent quotas. Zero means
+	// unlimited.
+	AWSRPS    float64 `mapstructure:"aws_rps"`
+	GoogleRPS float64 `mapstructure:"google_rps"`
+
+	// MaxGroupDepth bounds how many levels of nested Google groups
+	// GetGroupMembers expands when resolving a group's membership.
+	// Zero uses the google package's own default.
+	MaxGroupDepth int `mapstructure:"max_group_depth"`
+
+	// IgnoreUsers and IgnoreGroups are glob patterns (matched against
+	// email/name) identifying users and groups ssosync should never
+	// touch, even if they appear in or disappear from Google.
+	IgnoreUsers  []string `mapstructure:"ignore_users"`
+	IgnoreGroups []string `mapstructure:"ignore_groups"`
+
+	// IncludeGroups, when non-empty, restricts a sync to Google groups
+	// whose name matches one of its glob patterns, instead of every
+	// group returned by GroupMatch.
+	IncludeGroups []string `mapstructure:"include_groups"`
+
+	// ManagedTag, when true, tags every user/group ssosync creates with
+	// a ssosync-owned SCIM externalId, and refuses to delete any AWS
+	// SSO user or group that lacks that tag. This makes it safe to
+	// point ssosync at a subset of Google or share the SSO tenant with
+	// other tooling, since cleanup never touches what it didn't create.
+	ManagedTag bool `mapstructure:"managed_tag"`
+
+	// IdentityProvider selects which identity.Source DoSync syncs from:
+	// "google" (the default) or "azuread". Unknown values are an error.
+	IdentityProvider string `mapstructure:"identity_provider"`
+
+	// AzureTenantID, AzureClientID and AzureClientSecret authenticate
+	// against Microsoft Graph when IdentityProvider is "azuread".
+	AzureTenantID     string `mapstructure:"azure_tenant_id"`
+	AzureClientID     string `mapstructure:"azure_client_id"`
+	AzureClientSecret string `mapstructure:"azure_client_secret"`
+}
+
+// New returns a Config populated with ssosync's defaults
+func New() *Config {
+	return &Config{
+		LogLevel:         "info",
+		LogFormat:        "text",
+		Concurrency:      10,
+		IdentityProvider: "google",
+	}
+}
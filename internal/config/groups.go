@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// GroupRule describes a single Google group that should be reconciled
+// into AWS SSO, and which of its members (if any) are in scope.
+type GroupRule struct {
+	// Name is the Google group's display name.
+	Name string `yaml:"name"`
+	// Description documents why the group is synced, for reviewers
+	// reading a diff of groups.yaml rather than this running code.
+	Description string `yaml:"description"`
+	// Include is a set of member email globs to sync. An empty Include
+	// means every member of the group is in scope.
+	Include []string `yaml:"include,omitempty"`
+	// Exclude is a set of member email globs to drop from the group
+	// after Include has been applied.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// GroupsConfig is the declarative groups.yaml schema: the full list of
+// Google groups ssosync is allowed to reconcile into AWS SSO.
+type GroupsConfig struct {
+	Groups []GroupRule `yaml:"groups"`
+}
+
+// LoadGroupsConfig reads and parses a declarative groups.yaml file
+func LoadGroupsConfig(path string) (*GroupsConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var gc GroupsConfig
+	if err := yaml.Unmarshal(b, &gc); err != nil {
+		return nil, err
+	}
+
+	return &gc, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package identity holds the provider-agnostic user/group model that
+// syncGSuite reconciles into AWS SSO, and the Source interface any
+// directory (Google Workspace, Azure AD/Entra ID, ...) implements to be
+// synced from.
+package identity
+
+// User is a directory user, independent of which identity provider it
+// came from.
+type User struct {
+	ID         string
+	Email      string
+	GivenName  string
+	FamilyName string
+}
+
+// Group is a directory group, independent of which identity provider it
+// came from.
+type Group struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// Member is a single member of a Group, independent of which identity
+// provider it came from.
+type Member struct {
+	ID    string
+	Email string
+}
+
+// Source is the interface syncGSuite uses to read users and groups from
+// an identity provider. google.NewClient and azuread.NewClient both
+// return one, and DoSync picks between them based on cfg.IdentityProvider.
+type Source interface {
+	// GetUsers returns every active user matching query, a
+	// provider-specific search expression. An empty query returns every
+	// user.
+	GetUsers(query string) ([]*User, error)
+	// GetDeletedUsers returns every user matching query that the
+	// provider currently lists as deleted.
+	GetDeletedUsers(query string) ([]*User, error)
+	// GetGroups returns every group matching query. An empty query
+	// returns every group.
+	GetGroups(query string) ([]*Group, error)
+	// GetGroupMembers returns the transitive union of g's user members,
+	// expanding any nested groups it contains.
+	GetGroupMembers(g *Group) ([]*Member, error)
+}
+
+// MembershipChecker is an optional capability a Source can implement: an
+// authoritative single-user membership check that callers resolving
+// membership from a GetGroupMembers snapshot can fall back on when that
+// snapshot might have missed someone (e.g. an external-domain member
+// nested inside a Google group, which Members.List can't enumerate).
+// Sources whose GetGroupMembers traversal is already exhaustive have no
+// reason to implement this, since re-running the same traversal for one
+// user would be wasted work.
+type MembershipChecker interface {
+	IsGroupMember(g *Group, email string) (bool, error)
+}
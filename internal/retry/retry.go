@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry provides a small exponential-backoff retrier shared by
+// the aws and google clients, which hit independent quotas and need to
+// back off 429/5xx responses without giving up a whole sync run.
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// MaxAttempts is the default number of times Do will call fn before
+// giving up and returning its last error.
+const MaxAttempts = 5
+
+// baseBackoff is the delay before the first retry; it doubles on each
+// subsequent attempt.
+const baseBackoff = 250 * time.Millisecond
+
+// Do calls fn until it succeeds, isRetryable(err) returns false, or
+// MaxAttempts have been made, backing off exponentially with jitter
+// between attempts.
+func Do(isRetryable func(error) bool, fn func() error) error {
+	backoff := baseBackoff
+
+	var err error
+	for attempt := 0; attempt < MaxAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) {
+			return err
+		}
+
+		if attempt == MaxAttempts-1 {
+			break
+		}
+
+		time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff))))
+		backoff *= 2
+	}
+
+	return err
+}
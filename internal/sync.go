@@ -16,99 +16,325 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"path"
+	"sync"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/awslabs/ssosync/internal/assignment"
 	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/azuread"
 	"github.com/awslabs/ssosync/internal/config"
 	"github.com/awslabs/ssosync/internal/google"
+	"github.com/awslabs/ssosync/internal/identity"
 	"go.uber.org/zap"
 
 	log "github.com/sirupsen/logrus"
-	admin "google.golang.org/api/admin/directory/v1"
 )
 
+// managedByExternalID is the SCIM externalId ssosync stamps on every
+// user/group it creates when cfg.ManagedTag is set, so a later cleanup
+// pass can tell its own creations apart from identities owned by other
+// tooling sharing the same AWS SSO tenant.
+const managedByExternalID = "ssosync"
+
 // SyncGSuite is the interface for synchronising users/groups
 type SyncGSuite interface {
 	SyncUsers() error
 	SyncGroups() error
+	SyncAssignments() error
 }
 
 // SyncGSuite is an object type that will synchronise real users and groups
 type syncGSuite struct {
-	aws    aws.Client
-	google google.Client
+	aws         aws.Client
+	identity    identity.Source
+	assignments assignment.Client
+	cfg         *config.Config
+
+	usersMu sync.Mutex
+	users   map[string]*aws.User
+
+	// groups holds the declarative groups.yaml rules when cfg.ConfigFile
+	// is set, keyed by group name. A nil map means every Google group
+	// should be mirrored, same as before this existed.
+	groups map[string]*config.GroupRule
+
+	// mappings holds the declarative group -> permission set/accounts
+	// assignments from cfg.MappingsFile, keyed by Google group name.
+	mappings map[string][]assignment.Mapping
+}
+
+// New will create a new SyncGSuite object. When cfg.ConfigFile is set,
+// SyncGroups only reconciles the groups (and members) it declares, and
+// when cfg.DryRun is set no create/update/delete is actually made against
+// aws or src, only logged. assignments may be nil when cfg.MappingsFile
+// is unset, in which case SyncAssignments is a no-op.
+func New(cfg *config.Config, a aws.Client, src identity.Source, assignments assignment.Client) (SyncGSuite, error) {
+	s := &syncGSuite{
+		aws:         a,
+		identity:    src,
+		assignments: assignments,
+		cfg:         cfg,
+		users:       make(map[string]*aws.User),
+	}
+
+	if cfg.ConfigFile != "" {
+		gc, err := config.LoadGroupsConfig(cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		s.groups = make(map[string]*config.GroupRule, len(gc.Groups))
+		for i := range gc.Groups {
+			s.groups[gc.Groups[i].Name] = &gc.Groups[i]
+		}
+	}
+
+	if cfg.MappingsFile != "" {
+		mappings, err := assignment.LoadMappings(cfg.MappingsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mappings = make(map[string][]assignment.Mapping)
+		for _, m := range mappings {
+			s.mappings[m.GroupName] = append(s.mappings[m.GroupName], m)
+		}
+	}
+
+	return s, nil
+}
+
+// dryRun reports whether to log rather than perform a mutating action,
+// and logs it when it does.
+func (s *syncGSuite) dryRun(action string, fields log.Fields) bool {
+	if !s.cfg.DryRun {
+		return false
+	}
+	log.WithFields(fields).Info("[dry-run] would " + action)
+	return true
+}
+
+// inScope reports whether the given Google group is part of this sync.
+// Every group is in scope unless a groups.yaml was loaded, in which case
+// only groups it names are reconciled.
+func (s *syncGSuite) inScope(groupName string) (*config.GroupRule, bool) {
+	if s.groups == nil {
+		return nil, true
+	}
+	rule, ok := s.groups[groupName]
+	return rule, ok
+}
+
+// setUser records a resolved AWS user, guarded for concurrent callers.
+func (s *syncGSuite) setUser(u *aws.User) {
+	s.usersMu.Lock()
+	s.users[u.Username] = u
+	s.usersMu.Unlock()
+}
+
+// snapshotUsers returns the currently known AWS users as a slice, safe
+// to range over from multiple goroutines while SyncUsers is still
+// populating s.users via setUser.
+func (s *syncGSuite) snapshotUsers() []*aws.User {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	users := make([]*aws.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	return users
+}
+
+// parallelize runs fn(0), fn(1), ..., fn(n-1) with at most concurrency
+// goroutines in flight at once, waiting for all of them to finish and
+// returning the first error encountered, if any. concurrency <= 0 means
+// unbounded.
+func parallelize(n int, concurrency int, fn func(i int) error) error {
+	if n == 0 {
+		return nil
+	}
+	if concurrency <= 0 || concurrency > n {
+		concurrency = n
+	}
+
+	sem := make(chan struct{}, concurrency)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs <- fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
 
-	users map[string]*aws.User
+	return nil
 }
 
-// New will create a new SyncGSuite object
-func New(a aws.Client, g google.Client) SyncGSuite {
-	return &syncGSuite{
-		aws:    a,
-		google: g,
-		users:  make(map[string]*aws.User),
+// matchesAnyPattern reports whether s matches any of the given globs.
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
 	}
+	return false
 }
 
-// SyncUsers will Sync Google Users to AWS SSO SCIM
+// groupInScope reports whether the given Google group name should be
+// synced at all, applying cfg.IncludeGroups and cfg.IgnoreGroups ahead
+// of the per-group groups.yaml rules handled by inScope.
+func (s *syncGSuite) groupInScope(groupName string) bool {
+	if len(s.cfg.IncludeGroups) > 0 && !matchesAnyPattern(s.cfg.IncludeGroups, groupName) {
+		return false
+	}
+	return !matchesAnyPattern(s.cfg.IgnoreGroups, groupName)
+}
+
+// canDelete reports whether a stale AWS user/group is safe to delete.
+// When cfg.ManagedTag is set, only identities ssosync itself tagged with
+// managedByExternalID may be deleted, so cleanup never touches anything
+// ssosync didn't create.
+func (s *syncGSuite) canDelete(externalID string) bool {
+	return !s.cfg.ManagedTag || externalID == managedByExternalID
+}
+
+// memberInScope applies a group rule's include/exclude globs to a
+// member's email. A rule with no Include patterns admits every member.
+func memberInScope(rule *config.GroupRule, email string) bool {
+	if rule == nil {
+		return true
+	}
+
+	included := len(rule.Include) == 0
+	for _, pattern := range rule.Include {
+		if ok, _ := path.Match(pattern, email); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+
+	for _, pattern := range rule.Exclude {
+		if ok, _ := path.Match(pattern, email); ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SyncUsers will sync users from the configured identity provider to
+// AWS SSO SCIM, processing up to cfg.Concurrency users at once.
 func (s *syncGSuite) SyncUsers() error {
 	log.Debug("get deleted users")
-	deletedUsers, err := s.google.GetDeletedUsers()
+	deletedUsers, err := s.identity.GetDeletedUsers(s.cfg.UserMatch)
 	if err != nil {
 		return err
 	}
 
-	for _, u := range deletedUsers {
-		uu, _ := s.aws.FindUserByEmail(u.PrimaryEmail)
-		if uu == nil {
-			continue
+	err = parallelize(len(deletedUsers), s.cfg.Concurrency, func(i int) error {
+		u := deletedUsers[i]
+		if matchesAnyPattern(s.cfg.IgnoreUsers, u.Email) {
+			return nil
 		}
 
-		log.WithFields(log.Fields{
-			"email": u.PrimaryEmail,
-		}).Info("deleting google user")
+		uu, _ := s.aws.FindUserByEmail(u.Email)
+		if uu == nil {
+			return nil
+		}
 
-		if err := s.aws.DeleteUser(uu); err != nil {
-			return err
+		fields := log.Fields{"email": u.Email}
+		if !s.canDelete(uu.ExternalID) {
+			log.WithFields(fields).Debug("user not managed by ssosync, skipping delete")
+			return nil
+		}
+		if s.dryRun("delete user", fields) {
+			return nil
 		}
+
+		log.WithFields(fields).Info("deleting user")
+		return s.aws.DeleteUser(uu)
+	})
+	if err != nil {
+		return err
 	}
 
-	log.Debug("get active google users")
-	googleUsers, err := s.google.GetUsers()
+	log.Debug("get active users")
+	activeUsers, err := s.identity.GetUsers(s.cfg.UserMatch)
 	if err != nil {
 		return err
 	}
 
-	for _, u := range googleUsers {
+	return parallelize(len(activeUsers), s.cfg.Concurrency, func(i int) error {
+		u := activeUsers[i]
+		if matchesAnyPattern(s.cfg.IgnoreUsers, u.Email) {
+			return nil
+		}
+
 		ll := log.WithFields(log.Fields{
-			"email": u.PrimaryEmail,
+			"email": u.Email,
 		})
 
 		ll.Debug("finding user")
-		uu, _ := s.aws.FindUserByEmail(u.PrimaryEmail)
+		uu, _ := s.aws.FindUserByEmail(u.Email)
 		if uu != nil {
-			s.users[uu.Username] = uu
-			continue
+			s.setUser(uu)
+			return nil
+		}
+
+		newUser := aws.NewUser(u.GivenName, u.FamilyName, u.Email)
+		if s.cfg.ManagedTag {
+			newUser.ExternalID = managedByExternalID
+		}
+
+		if s.dryRun("create user", log.Fields{"email": u.Email}) {
+			s.setUser(newUser)
+			return nil
 		}
 
 		ll.Info("creating user")
-		uu, err := s.aws.CreateUser(aws.NewUser(
-			u.Name.GivenName,
-			u.Name.FamilyName,
-			u.PrimaryEmail,
-		))
+		created, err := s.aws.CreateUser(newUser)
 		if err != nil {
 			return err
 		}
 
-		s.users[uu.Username] = uu
-	}
-
-	return nil
+		s.setUser(created)
+		return nil
+	})
 }
 
-// SyncGroups will sync groups from Google -> AWS SSO
+// SyncGroups will sync groups from the configured identity provider to
+// AWS SSO, diffing up to cfg.Concurrency groups at once. Membership on
+// each side is resolved with a single call per group -
+// ListGroupMemberships on the AWS side, GetGroupMembers (which
+// transparently expands nested groups where the provider supports them)
+// on the identity provider side - rather than one request per candidate
+// user. For providers implementing identity.MembershipChecker, a user
+// AWS already has in the group but GetGroupMembers didn't surface is
+// double-checked with IsGroupMember before being removed, so a gap in
+// the provider's recursive expansion doesn't show up as a membership
+// revoke.
 func (s *syncGSuite) SyncGroups() error {
 	log.Debug("get sso groups")
 	awsGroups, err := s.aws.GetGroups()
@@ -116,109 +342,243 @@ func (s *syncGSuite) SyncGroups() error {
 		return err
 	}
 
-	log.Debug("get google groups")
-	googleGroups, err := s.google.GetGroups()
+	log.Debug("get identity provider groups")
+	identityGroups, err := s.identity.GetGroups(s.cfg.GroupMatch)
 	if err != nil {
 		return err
 	}
 
 	correlatedGroups := make(map[string]*aws.Group)
+	var correlatedMu sync.Mutex
 
-	for _, g := range googleGroups {
+	err = parallelize(len(identityGroups), s.cfg.Concurrency, func(i int) error {
+		g := identityGroups[i]
 		log := log.WithFields(log.Fields{
 			"group": g.Name,
 		})
 
-		log.Debug("Check group")
+		rule, ok := s.inScope(g.Name)
+		if !ok {
+			log.Debug("Group not declared in groups.yaml, skipping")
+			return nil
+		}
+		if !s.groupInScope(g.Name) {
+			log.Debug("Group excluded by include/ignore-groups, skipping")
+			return nil
+		}
+
+		log.Debug("Check identity provider group")
 
 		var group *aws.Group
 
 		if awsGroup, ok := (*awsGroups)[g.Name]; ok {
 			log.Debug("Found group")
-			correlatedGroups[awsGroup.DisplayName] = &awsGroup
 			group = &awsGroup
 		} else {
-			log.Info("Creating group in AWS")
-			newGroup, err := s.aws.CreateGroup(aws.NewGroup(g.Name))
+			newGroup := aws.NewGroup(g.Name)
+			if s.cfg.ManagedTag {
+				newGroup.ExternalID = managedByExternalID
+			}
+
+			if s.dryRun("create group in AWS", log.Data) {
+				group = newGroup
+			} else {
+				log.Info("Creating group in AWS")
+				created, err := s.aws.CreateGroup(newGroup)
+				if err != nil {
+					return err
+				}
+				group = created
+			}
+		}
+
+		correlatedMu.Lock()
+		correlatedGroups[group.DisplayName] = group
+		correlatedMu.Unlock()
+
+		memberIDs := map[string]bool{}
+		if group.ID != "" {
+			ids, err := s.aws.ListGroupMemberships(group)
 			if err != nil {
 				return err
 			}
-			correlatedGroups[newGroup.DisplayName] = newGroup
-			group = newGroup
+			memberIDs = ids
 		}
 
-		groupMembers, err := s.google.GetGroupMembers(g)
+		identityMembers, err := s.identity.GetGroupMembers(g)
 		if err != nil {
 			return err
 		}
 
-		memberList := make(map[string]*admin.Member)
+		identityMemberEmails := make(map[string]bool, len(identityMembers))
+		for _, m := range identityMembers {
+			identityMemberEmails[m.Email] = true
+		}
 
 		log.Info("Start group user sync")
 
-		for _, m := range groupMembers {
-			if _, ok := s.users[m.Email]; ok {
-				memberList[m.Email] = m
-			}
-		}
-
-		for _, u := range s.users {
-			log.WithField("user", u.Username).Debug("Checking user is in group already")
-			b, err := s.aws.IsUserInGroup(u, group)
-			if err != nil {
-				return err
+		users := s.snapshotUsers()
+
+		// membershipChecker is non-nil only for identity sources whose
+		// GetGroupMembers traversal can miss a member it wouldn't miss
+		// on a direct per-user check (see identity.MembershipChecker);
+		// sources without the gap don't pay for a fallback they'd never
+		// need.
+		membershipChecker, _ := s.identity.(identity.MembershipChecker)
+
+		return parallelize(len(users), s.cfg.Concurrency, func(j int) error {
+			u := users[j]
+			log := log.WithField("user", u.Username)
+
+			log.Debug("Checking user is in group already")
+			inAWSGroup := memberIDs[u.ID]
+			inIdentityGroup := identityMemberEmails[u.Username]
+
+			if !inIdentityGroup && inAWSGroup && membershipChecker != nil {
+				// identityMemberEmails came from a single recursive
+				// listing call, which some providers can't fully
+				// enumerate (e.g. an external-domain member nested
+				// inside a Google group). Before removing a user AWS
+				// thinks is a member, confirm with an authoritative
+				// per-user check rather than trusting the miss.
+				member, err := membershipChecker.IsGroupMember(g, u.Username)
+				if err != nil {
+					return err
+				}
+				inIdentityGroup = member
 			}
+			inIdentityGroup = inIdentityGroup && memberInScope(rule, u.Username)
 
-			if _, ok := memberList[u.Username]; ok {
-				if !b {
-					log.WithField("user", u.Username).Info("Adding user to group")
-					err := s.aws.AddUserToGroup(u, group)
-					if err != nil {
-						return err
-					}
+			if inIdentityGroup {
+				if inAWSGroup {
+					return nil
 				}
-			} else {
-				if b {
-					log.WithField("user", u.Username).Info("Removing user from group")
-					err := s.aws.RemoveUserFromGroup(u, group)
-					if err != nil {
-						return err
-					}
+				if s.dryRun("add user to group", log.Data) {
+					return nil
 				}
+				log.Info("Adding user to group")
+				return s.aws.AddUserToGroup(u, group)
 			}
-		}
+
+			if !inAWSGroup {
+				return nil
+			}
+			if s.dryRun("remove user from group", log.Data) {
+				return nil
+			}
+			log.Info("Removing user from group")
+			return s.aws.RemoveUserFromGroup(u, group)
+		})
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Info("Clean up AWS groups")
+	staleGroups := make([]aws.Group, 0, len(*awsGroups))
 	for _, g := range *awsGroups {
-		if _, ok := correlatedGroups[g.DisplayName]; !ok {
-			log.Info("Delete Group in AWS", zap.String("group", g.DisplayName))
-			err := s.aws.DeleteGroup(&g)
-			if err != nil {
-				return err
-			}
+		if _, ok := correlatedGroups[g.DisplayName]; ok {
+			continue
+		}
+		if _, ok := s.inScope(g.DisplayName); !ok {
+			continue
+		}
+		if !s.groupInScope(g.DisplayName) {
+			continue
 		}
+		staleGroups = append(staleGroups, g)
 	}
 
-	return nil
+	return parallelize(len(staleGroups), s.cfg.Concurrency, func(i int) error {
+		g := staleGroups[i]
+
+		fields := log.Fields{"group": g.DisplayName}
+		if !s.canDelete(g.ExternalID) {
+			log.WithFields(fields).Debug("group not managed by ssosync, skipping delete")
+			return nil
+		}
+		if s.dryRun("delete group in AWS", fields) {
+			return nil
+		}
+		log.Info("Delete Group in AWS", zap.String("group", g.DisplayName))
+		return s.aws.DeleteGroup(&g)
+	})
 }
 
-// DoSync will create a logger and run the sync with the paths
-// given to do the sync.
-func DoSync(ctx context.Context, cfg *config.Config) error {
-	log.Info("Creating the Google and AWS Clients needed")
+// SyncAssignments reconciles AWS SSO account assignments for every
+// group declared in cfg.MappingsFile, granting their members the
+// mapped permission sets on the mapped AWS accounts. It is a no-op
+// when no MappingsFile was configured.
+func (s *syncGSuite) SyncAssignments() error {
+	if s.mappings == nil {
+		return nil
+	}
 
-	creds := []byte(cfg.GoogleCredentials)
+	awsGroups, err := s.aws.GetGroups()
+	if err != nil {
+		return err
+	}
 
-	if !cfg.IsLambda {
-		b, err := ioutil.ReadFile(cfg.GoogleCredentials)
-		if err != nil {
+	for groupName, mappings := range s.mappings {
+		log := log.WithField("group", groupName)
+
+		awsGroup, ok := (*awsGroups)[groupName]
+		if !ok {
+			log.Warn("Group in mappings file not found in AWS SSO, skipping")
+			continue
+		}
+
+		if s.dryRun("reconcile account assignments", log.Data) {
+			continue
+		}
+
+		log.Info("Reconciling account assignments")
+		if err := s.assignments.Reconcile(context.Background(), awsGroup.ID, mappings); err != nil {
 			return err
 		}
-		creds = b
 	}
 
-	googleClient, err := google.NewClient(ctx, cfg.GoogleAdmin, creds)
+	return nil
+}
+
+// newIdentitySource builds the identity.Source for cfg.IdentityProvider
+// ("google" when unset, or "azuread").
+func newIdentitySource(ctx context.Context, cfg *config.Config) (identity.Source, error) {
+	switch cfg.IdentityProvider {
+	case "", "google":
+		creds := []byte(cfg.GoogleCredentials)
+		if !cfg.IsLambda {
+			b, err := ioutil.ReadFile(cfg.GoogleCredentials)
+			if err != nil {
+				return nil, err
+			}
+			creds = b
+		}
+
+		return google.NewClient(ctx, &google.Config{
+			AdminEmail:    cfg.GoogleAdmin,
+			Credentials:   creds,
+			RPS:           cfg.GoogleRPS,
+			MaxGroupDepth: cfg.MaxGroupDepth,
+		})
+	case "azuread":
+		return azuread.NewClient(ctx, &azuread.Config{
+			TenantID:      cfg.AzureTenantID,
+			ClientID:      cfg.AzureClientID,
+			ClientSecret:  cfg.AzureClientSecret,
+			MaxGroupDepth: cfg.MaxGroupDepth,
+		})
+	default:
+		return nil, fmt.Errorf("internal: unknown identity provider %q", cfg.IdentityProvider)
+	}
+}
+
+// DoSync will create a logger and run the sync with the paths
+// given to do the sync.
+func DoSync(ctx context.Context, cfg *config.Config) error {
+	log.Info("Creating the identity provider and AWS clients needed")
+
+	identitySource, err := newIdentitySource(ctx, cfg)
 	if err != nil {
 		return err
 	}
@@ -228,12 +588,26 @@ func DoSync(ctx context.Context, cfg *config.Config) error {
 		&aws.Config{
 			Endpoint: cfg.SCIMEndpoint,
 			Token:    cfg.SCIMAccessToken,
+			RPS:      cfg.AWSRPS,
 		})
 	if err != nil {
 		return err
 	}
 
-	c := New(awsClient, googleClient)
+	var assignmentClient assignment.Client
+	if cfg.MappingsFile != "" {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+		if err != nil {
+			return err
+		}
+		assignmentClient = assignment.NewClient(awsCfg, cfg.SSOInstanceArn)
+	}
+
+	c, err := New(cfg, awsClient, identitySource, assignmentClient)
+	if err != nil {
+		return err
+	}
+
 	err = c.SyncUsers()
 	if err != nil {
 		return err
@@ -244,5 +618,10 @@ func DoSync(ctx context.Context, cfg *config.Config) error {
 		return err
 	}
 
+	err = c.SyncAssignments()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }